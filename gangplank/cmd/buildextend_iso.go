@@ -0,0 +1,311 @@
+package main
+
+/*
+	Definition for the "buildextend-iso" command.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	uefiGrubDir = "/usr/lib/grub/x86_64-efi"
+
+	// shimPath and grubEFIPath are the signed UEFI Secure Boot binaries
+	// cosa images already ship; when present they're staged into the ISO
+	// instead of relying on grub-mkrescue's own unsigned grubx64.efi.
+	shimPath    = "/boot/efi/EFI/redhat/shimx64.efi"
+	grubEFIPath = "/boot/efi/EFI/redhat/grubx64.efi"
+)
+
+var (
+	isoBuildID string
+	isoArch    string
+	isoBoot    bool
+
+	cmdBuildExtendISO = &cobra.Command{
+		Use:   "buildextend-iso",
+		Short: "Assemble a bootable ISO from the latest build",
+		Run:   runBuildExtendISO,
+	}
+)
+
+func init() {
+	cmdRoot.AddCommand(cmdBuildExtendISO)
+	cmdBuildExtendISO.Flags().StringVar(&isoBuildID, "build", "latest", "build ID under builds/ to assemble the ISO from")
+	cmdBuildExtendISO.Flags().StringVar(&isoArch, "arch", "x86_64", "target architecture")
+	cmdBuildExtendISO.Flags().BoolVar(&isoBoot, "boot", false, "assemble a bootable live ISO via grub-mkrescue")
+}
+
+// buildImage is the subset of a meta.json "images" entry that a live ISO
+// needs to record: where it lives relative to the build directory, and
+// its checksum/size for the same provenance checks cosa does for every
+// other artifact.
+type buildImage struct {
+	Path   string `json:"path"`
+	Sha256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// buildMeta is the subset of meta.json that buildextend-iso reads and
+// writes. It is never marshaled on its own: loadBuildMeta also returns the
+// whole document as a generic map, and saveBuildMeta merges buildMeta's
+// images into that map, so fields buildMeta doesn't model are kept.
+type buildMeta struct {
+	BuildID string                `json:"buildid"`
+	Images  map[string]buildImage `json:"images"`
+}
+
+func loadBuildMeta(path string) (*buildMeta, map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+
+	meta := &buildMeta{Images: map[string]buildImage{}}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+
+	return meta, raw, nil
+}
+
+func saveBuildMeta(path string, meta *buildMeta, raw map[string]interface{}) error {
+	// Update raw["images"] entry-by-entry instead of replacing it outright:
+	// meta.Images only models the fields buildextend-iso cares about, so
+	// overwriting the whole map would drop any other per-image field cosa
+	// wrote (e.g. a second checksum, a skip-compression flag).
+	images, _ := raw["images"].(map[string]interface{})
+	if images == nil {
+		images = map[string]interface{}{}
+	}
+	for name, img := range meta.Images {
+		entry, ok := images[name].(map[string]interface{})
+		if !ok {
+			entry = map[string]interface{}{}
+		}
+		entry["path"] = img.Path
+		entry["sha256"] = img.Sha256
+		entry["size"] = img.Size
+		images[name] = entry
+	}
+	raw["images"] = images
+
+	data, err := json.MarshalIndent(raw, "", "    ")
+	if err != nil {
+		return fmt.Errorf("encoding %s: %v", path, err)
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+func runBuildExtendISO(c *cobra.Command, args []string) {
+	if !isoBoot {
+		log.Fatalf("buildextend-iso requires --boot")
+	}
+
+	buildDir := filepath.Join(localCosaDir, "builds", isoBuildID, isoArch)
+	metaPath := filepath.Join(buildDir, "meta.json")
+
+	meta, raw, err := loadBuildMeta(metaPath)
+	if err != nil {
+		log.Fatalf("failed to load build metadata: %v", err)
+	}
+
+	isoPath, sha256sum, size, err := assembleLiveISO(buildDir, meta)
+	if err != nil {
+		log.Fatalf("failed to assemble live ISO: %v", err)
+	}
+
+	meta.Images["live-iso"] = buildImage{
+		Path:   filepath.Base(isoPath),
+		Sha256: sha256sum,
+		Size:   size,
+	}
+
+	if err := saveBuildMeta(metaPath, meta, raw); err != nil {
+		log.Fatalf("failed to update meta.json: %v", err)
+	}
+
+	log.Infof("wrote %s (%d bytes, sha256 %s)", isoPath, size, sha256sum)
+}
+
+// assembleLiveISO stages a grub layout for buildDir's kernel/initramfs/
+// rootfs in a temp dir and turns it into an isohybrid image with
+// grub-mkrescue, supporting BIOS and (when available) UEFI boot.
+func assembleLiveISO(buildDir string, meta *buildMeta) (path string, sha256sum string, size int64, err error) {
+	stage, err := os.MkdirTemp("", "cosa-live-iso-")
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer os.RemoveAll(stage)
+
+	if err := stageLiveFiles(stage, buildDir, meta); err != nil {
+		return "", "", 0, err
+	}
+
+	volID := volumeID(meta.BuildID)
+
+	isoPath := filepath.Join(buildDir, fmt.Sprintf("%s-live.iso", meta.BuildID))
+
+	args := []string{
+		"-o", isoPath,
+		"-volid", volID,
+		"--modules", "linux normal iso9660 biosdisk memdisk search",
+	}
+	if hasUEFIGrub() {
+		args = append(args, "-d", uefiGrubDir)
+	}
+	args = append(args, stage)
+
+	cmd := exec.Command("grub-mkrescue", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", "", 0, fmt.Errorf("grub-mkrescue: %v", err)
+	}
+
+	sha256sum, size, err = hashFile(isoPath)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	return isoPath, sha256sum, size, nil
+}
+
+func stageLiveFiles(stage, buildDir string, meta *buildMeta) error {
+	copies := map[string]string{
+		"kernel":    "vmlinuz",
+		"initramfs": "initrd",
+		"rootfs":    "squashfs.img",
+	}
+
+	for image, destName := range copies {
+		img, ok := meta.Images[image]
+		if !ok {
+			return fmt.Errorf("meta.json has no %q image to stage for the live ISO", image)
+		}
+		if err := copyFile(filepath.Join(buildDir, img.Path), filepath.Join(stage, destName)); err != nil {
+			return fmt.Errorf("staging %s: %v", image, err)
+		}
+	}
+
+	grubDir := filepath.Join(stage, "boot", "grub")
+	if err := os.MkdirAll(grubDir, 0755); err != nil {
+		return err
+	}
+
+	grubCfg := `search --set=root --file /config.yaml
+set default=0
+set timeout=5
+
+menuentry "CoreOS (live)" {
+	linux /vmlinuz coreos.liveiso=1
+	initrd /initrd
+}
+`
+	if err := os.WriteFile(filepath.Join(grubDir, "grub.cfg"), []byte(grubCfg), 0644); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(stage, "config.yaml"), []byte(fmt.Sprintf("buildid: %s\n", meta.BuildID)), 0644); err != nil {
+		return err
+	}
+
+	if hasSignedShim() {
+		if err := stageUEFIShim(stage); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func hasUEFIGrub() bool {
+	_, err := os.Stat(uefiGrubDir)
+	return err == nil
+}
+
+func hasSignedShim() bool {
+	_, err := os.Stat(shimPath)
+	return err == nil
+}
+
+// stageUEFIShim stages the signed shim and grubx64.efi at the fallback
+// UEFI boot path (EFI/BOOT/BOOTX64.EFI), the same layout cosa's disk
+// images use, so the live ISO boots under UEFI Secure Boot instead of
+// relying on grub-mkrescue's own unsigned grubx64.efi.
+func stageUEFIShim(stage string) error {
+	bootDir := filepath.Join(stage, "EFI", "BOOT")
+	if err := os.MkdirAll(bootDir, 0755); err != nil {
+		return err
+	}
+
+	if err := copyFile(shimPath, filepath.Join(bootDir, "BOOTX64.EFI")); err != nil {
+		return fmt.Errorf("staging signed shim: %v", err)
+	}
+
+	if err := copyFile(grubEFIPath, filepath.Join(bootDir, "grubx64.efi")); err != nil {
+		return fmt.Errorf("staging grubx64.efi: %v", err)
+	}
+
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// volumeID derives a deterministic, ISO9660-safe (uppercase, <=32 char)
+// volume ID from the build ID so two runs against the same build give
+// their ISOs the same volume ID. Other inputs to grub-mkrescue, such as
+// the staged files' timestamps, are not fixed here.
+func volumeID(buildID string) string {
+	sum := sha256.Sum256([]byte(buildID))
+	return strings.ToUpper(fmt.Sprintf("COREOS_%s", hex.EncodeToString(sum[:])[:8]))
+}
@@ -6,12 +6,14 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
 	"github.com/coreos/gangplank/ocp"
 	"github.com/coreos/gangplank/remote"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"os"
-	"path/filepath"
 )
 
 var (
@@ -19,6 +21,9 @@ var (
 	jobSpec       string
 	buildSteps    string
 	localCosaDir  string
+	incremental   bool
+	deleteRemote  bool
+	receiveSync   bool
 
 	cmdRemote = &cobra.Command{
 		Use:   "remote",
@@ -33,6 +38,9 @@ func init() {
 	cmdRemote.Flags().StringVarP(&jobSpec, "jobSpec", "j", "", "location of the jobSpec")
 	cmdRemote.Flags().StringVarP(&buildSteps, "buildSteps", "b", "", "location of the build.steps")
 	cmdRemote.Flags().StringVarP(&localCosaDir, "localCosaDir", "l", "", "location of the local cosa source")
+	cmdRemote.Flags().BoolVar(&incremental, "incremental", false, "sync only changed files instead of shipping a full devel.tar")
+	cmdRemote.Flags().BoolVar(&deleteRemote, "delete", false, "with --incremental, also remove remote files that no longer exist locally")
+	cmdRemote.Flags().BoolVar(&receiveSync, "receive", false, "run as the pod-side receiver for an incremental sync; set by the builder pod's entrypoint, not meant for interactive use")
 
 	if localCosaDir == "" {
 		path, err := os.Getwd()
@@ -44,7 +52,19 @@ func init() {
 	}
 }
 
+// runRemote is invoked on both ends of an incremental sync: with --receive
+// it is the pod-side handler the builder pod's entrypoint execs to speak
+// the sync protocol on its stdio before the normal build steps run; without
+// it, it is the client-side command a developer runs to ship their local
+// checkout to that pod.
 func runRemote(c *cobra.Command, args []string) {
+	if receiveSync {
+		if err := remote.Receive(syncRW{r: os.Stdin, w: os.Stdout}, cosaWorkDir); err != nil {
+			log.Fatalf("incremental sync receive failed: %v", err)
+		}
+		return
+	}
+
 	// check that the cosa dir exists
 	_, err := os.Stat(localCosaDir)
 	if os.IsNotExist(err) {
@@ -91,35 +111,40 @@ func runRemote(c *cobra.Command, args []string) {
 		includes = append(includes, buildSteps)
 	}
 
-	// dest is the target archive file
-	dest := fmt.Sprintf("%s/devel.tar", localCosaDir)
-
-	// emptyDirs includes the directory names to create empty directories in the archive
-	var emptyDirs []string
-	emptyDirs = append(emptyDirs, "tmp")
-	emptyDirs = append(emptyDirs, "cache")
-	if !containBuilds {
-		emptyDirs = append(emptyDirs, "builds")
-	}
-
-	a := remote.CosaArchive{
-		CreateDirs: emptyDirs,
-		Includes:   includes,
-	}
-	if err := a.CreateArchive(dest); err != nil {
-		log.Fatalf("failed to create the tar ball: %v", err)
-	}
-
 	// create a cluster that uses podman
 	cluster := ocp.NewCluster(false, "")
 	cluster.SetPodman(cosaSrvDir)
 
-	// pass the archive file to the cluster
-	f, err := os.Open(dest)
-	if err != nil {
-		log.Fatalf("failed to open the archive %v: %v", dest, err)
+	var syncDone func() error
+	if incremental {
+		syncDone = setupIncrementalSync(cluster)
+	} else {
+		// dest is the target archive file
+		dest := fmt.Sprintf("%s/devel.tar", localCosaDir)
+
+		// emptyDirs includes the directory names to create empty directories in the archive
+		var emptyDirs []string
+		emptyDirs = append(emptyDirs, "tmp")
+		emptyDirs = append(emptyDirs, "cache")
+		if !containBuilds {
+			emptyDirs = append(emptyDirs, "builds")
+		}
+
+		a := remote.CosaArchive{
+			CreateDirs: emptyDirs,
+			Includes:   includes,
+		}
+		if err := a.CreateArchive(dest); err != nil {
+			log.Fatalf("failed to create the tar ball: %v", err)
+		}
+
+		// pass the archive file to the cluster
+		f, err := os.Open(dest)
+		if err != nil {
+			log.Fatalf("failed to open the archive %v: %v", dest, err)
+		}
+		cluster.SetStdIO(f, os.Stdout, os.Stderr)
 	}
-	cluster.SetStdIO(f, os.Stdout, os.Stderr)
 
 	clusterCtx := ocp.NewClusterContext(ctx, cluster)
 	if jobSpec != "" {
@@ -135,4 +160,56 @@ func runRemote(c *cobra.Command, args []string) {
 	if err := pb.Exec(clusterCtx); err != nil {
 		log.Fatalf("failed to execute CI builder: %v", err)
 	}
+
+	if syncDone != nil {
+		if err := syncDone(); err != nil {
+			log.Fatalf("incremental sync failed: %v", err)
+		}
+	}
+}
+
+// syncRW joins a separate reader and writer into the single io.ReadWriter
+// that Syncer.Sync and remote.Receive take: os.Stdin/os.Stdout on the pod
+// side, and on the client side the pair of io.Pipes setupIncrementalSync
+// creates, since cluster.SetStdIO only takes a stdin reader and a stdout
+// writer.
+type syncRW struct {
+	r io.Reader
+	w io.Writer
+}
+
+func (s syncRW) Read(p []byte) (int, error)  { return s.r.Read(p) }
+func (s syncRW) Write(p []byte) (int, error) { return s.w.Write(p) }
+
+// setupIncrementalSync wires cluster's stdio to an in-process Syncer and
+// runs the sync in the background, returning a function that blocks for
+// its completion and persists the resulting manifest for the next run.
+//
+// This only works end-to-end if the builder pod's command execs
+// `gangplank remote --receive` to run runRemote's pod-side branch against
+// its own stdio before falling through to the normal build steps.
+func setupIncrementalSync(cluster *ocp.Cluster) func() error {
+	toPodR, toPodW := io.Pipe()
+	fromPodR, fromPodW := io.Pipe()
+
+	cluster.SetStdIO(toPodR, fromPodW, os.Stderr)
+
+	s := &remote.Syncer{
+		LocalDir:     localCosaDir,
+		ManifestPath: filepath.Join(localCosaDir, "tmp", "remote-manifest.json"),
+		Delete:       deleteRemote,
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		manifest, err := s.Sync(syncRW{r: fromPodR, w: toPodW})
+		if err == nil {
+			err = remote.SaveManifest(s.ManifestPath, manifest)
+		}
+		result <- err
+	}()
+
+	return func() error {
+		return <-result
+	}
 }
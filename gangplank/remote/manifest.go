@@ -0,0 +1,130 @@
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FileMeta records a file's size, mtime and SHA-256 content hash.
+// BuildManifest hashes every file on every run, and Diff treats a file as
+// changed when its size or hash differs; the mtime is recorded but not
+// compared.
+type FileMeta struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	Hash    string `json:"hash"`
+}
+
+// Manifest maps a path, relative to the directory it was built from, to
+// its FileMeta.
+type Manifest map[string]FileMeta
+
+// BuildManifest walks root and hashes every regular file under it into a
+// Manifest keyed by its path relative to root.
+func BuildManifest(root string) (Manifest, error) {
+	m := Manifest{}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		hash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+
+		m[rel] = FileMeta{
+			Size:    info.Size(),
+			ModTime: info.ModTime().UnixNano(),
+			Hash:    hash,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Diff compares m (the manifest just built locally) against remote (the
+// manifest the far end reported it already has) and returns the paths
+// that are new or changed and the paths present in remote but missing
+// locally.
+func (m Manifest) Diff(remote Manifest) (changed, removed []string) {
+	for path, meta := range m {
+		rmeta, ok := remote[path]
+		if !ok || rmeta.Size != meta.Size || rmeta.Hash != meta.Hash {
+			changed = append(changed, path)
+		}
+	}
+
+	for path := range remote {
+		if _, ok := m[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+
+	return changed, removed
+}
+
+// LoadManifest reads a Manifest previously written by SaveManifest. A
+// missing file is not an error; it just means there is nothing cached yet
+// and everything should be treated as changed.
+func LoadManifest(path string) (Manifest, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Manifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := Manifest{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SaveManifest writes m to path as JSON, creating parent directories as
+// needed.
+func SaveManifest(path string, m Manifest) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
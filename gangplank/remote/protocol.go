@@ -0,0 +1,109 @@
+package remote
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// frameKind identifies the payload carried by a frame on the sync
+// protocol's stdio channel.
+type frameKind uint8
+
+const (
+	frameHello frameKind = iota
+	frameManifestRequest
+	frameManifestResponse
+	frameFileChunk
+	frameDelete
+	frameDone
+)
+
+// helloFrame is sent first by the client to announce the sync it is about
+// to drive.
+type helloFrame struct {
+	Incremental bool `json:"incremental"`
+	Delete      bool `json:"delete"`
+}
+
+// manifestResponseFrame carries the manifest the far end already has on
+// disk, so the sender only needs to ship what changed.
+type manifestResponseFrame struct {
+	Manifest Manifest `json:"manifest"`
+}
+
+// fileChunkFrame carries one file's full contents. Files are small enough
+// in practice (source trees, not build artifacts) that chunking within a
+// single file is not worth the complexity; "chunk" here means "one frame
+// per file".
+type fileChunkFrame struct {
+	Path string `json:"path"`
+	Mode uint32 `json:"mode"`
+	Data []byte `json:"data"`
+}
+
+// deleteFrame asks the receiver to remove a path that no longer exists on
+// the sender's side.
+type deleteFrame struct {
+	Path string `json:"path"`
+}
+
+// frameWriter and frameReader implement a simple length-prefixed framing
+// of JSON-encoded payloads over the existing stdio channel used by the tar
+// fallback. A real CBOR/protobuf wire format would save bytes, but JSON
+// keeps this dependency-free while the tar path remains the fallback for
+// anything the incremental sync can't handle.
+type frameWriter struct {
+	w io.Writer
+}
+
+func newFrameWriter(w io.Writer) *frameWriter {
+	return &frameWriter{w: w}
+}
+
+func (fw *frameWriter) write(kind frameKind, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encoding %T frame: %v", payload, err)
+	}
+
+	header := make([]byte, 5)
+	header[0] = byte(kind)
+	binary.BigEndian.PutUint32(header[1:], uint32(len(body)))
+
+	if _, err := fw.w.Write(header); err != nil {
+		return err
+	}
+	_, err = fw.w.Write(body)
+	return err
+}
+
+type frameReader struct {
+	r io.Reader
+}
+
+func newFrameReader(r io.Reader) *frameReader {
+	return &frameReader{r: r}
+}
+
+func unmarshalFrame(body []byte, v interface{}) error {
+	return json.Unmarshal(body, v)
+}
+
+func (fr *frameReader) read() (frameKind, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(fr.r, header); err != nil {
+		return 0, nil, err
+	}
+
+	kind := frameKind(header[0])
+	size := binary.BigEndian.Uint32(header[1:])
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(fr.r, body); err != nil {
+		return 0, nil, err
+	}
+
+	return kind, body, nil
+}
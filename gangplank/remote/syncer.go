@@ -0,0 +1,202 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Syncer drives the incremental sync protocol on top of the same stdio
+// channel CosaArchive uses for the tar transport. Unlike CosaArchive, which
+// always ships every file under src/overrides/builds, Syncer diffs a
+// content-addressed manifest against one the far end reports and only
+// sends what changed, falling back to the tar path entirely for callers
+// that don't opt into --incremental.
+type Syncer struct {
+	// LocalDir is the cosa working directory being synced (src, overrides,
+	// ...), matching the layout CosaArchive.Includes expects.
+	LocalDir string
+	// ManifestPath is where the local manifest from the previous run is
+	// cached, e.g. $localCosaDir/tmp/remote-manifest.json.
+	ManifestPath string
+	// Delete mirrors remote deletions of files missing locally.
+	Delete bool
+}
+
+// Sync runs one incremental sync pass: it builds the local manifest,
+// exchanges it with the remote side over rw, ships changed/new files, and
+// (if s.Delete) asks the remote side to remove files it has that are no
+// longer present locally. It returns the manifest it built so the caller
+// can persist it for the next run.
+func (s *Syncer) Sync(rw io.ReadWriter) (Manifest, error) {
+	local, err := BuildManifest(s.LocalDir)
+	if err != nil {
+		return nil, fmt.Errorf("building local manifest: %v", err)
+	}
+
+	fw := newFrameWriter(rw)
+	fr := newFrameReader(rw)
+
+	if err := fw.write(frameHello, helloFrame{Incremental: true, Delete: s.Delete}); err != nil {
+		return nil, fmt.Errorf("sending hello: %v", err)
+	}
+
+	if err := fw.write(frameManifestRequest, struct{}{}); err != nil {
+		return nil, fmt.Errorf("requesting remote manifest: %v", err)
+	}
+
+	kind, body, err := fr.read()
+	if err != nil {
+		return nil, fmt.Errorf("reading remote manifest: %v", err)
+	}
+	if kind != frameManifestResponse {
+		return nil, fmt.Errorf("expected manifest response frame, got %v", kind)
+	}
+
+	var resp manifestResponseFrame
+	if err := unmarshalFrame(body, &resp); err != nil {
+		return nil, fmt.Errorf("decoding remote manifest: %v", err)
+	}
+
+	changed, removed := local.Diff(resp.Manifest)
+	log.Infof("incremental sync: %d changed, %d removed", len(changed), len(removed))
+
+	for _, path := range changed {
+		if err := s.sendFile(fw, path); err != nil {
+			return nil, fmt.Errorf("sending %s: %v", path, err)
+		}
+	}
+
+	if s.Delete {
+		for _, path := range removed {
+			if err := fw.write(frameDelete, deleteFrame{Path: path}); err != nil {
+				return nil, fmt.Errorf("sending delete for %s: %v", path, err)
+			}
+		}
+	}
+
+	if err := fw.write(frameDone, struct{}{}); err != nil {
+		return nil, fmt.Errorf("sending done: %v", err)
+	}
+
+	return local, nil
+}
+
+func (s *Syncer) sendFile(fw *frameWriter, rel string) error {
+	full := filepath.Join(s.LocalDir, rel)
+
+	info, err := os.Stat(full)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(full)
+	if err != nil {
+		return err
+	}
+
+	return fw.write(frameFileChunk, fileChunkFrame{
+		Path: rel,
+		Mode: uint32(info.Mode().Perm()),
+		Data: data,
+	})
+}
+
+// Receive runs the remote side of the protocol: it reports its own
+// manifest (rooted at localDir, the pod's checkout) and applies whatever
+// FileChunk/Delete frames the sender ships until it sees Done.
+func Receive(rw io.ReadWriter, localDir string) error {
+	fr := newFrameReader(rw)
+	fw := newFrameWriter(rw)
+
+	if kind, _, err := fr.read(); err != nil {
+		return fmt.Errorf("reading hello: %v", err)
+	} else if kind != frameHello {
+		return fmt.Errorf("expected hello frame, got %v", kind)
+	}
+
+	if kind, _, err := fr.read(); err != nil {
+		return fmt.Errorf("reading manifest request: %v", err)
+	} else if kind != frameManifestRequest {
+		return fmt.Errorf("expected manifest request frame, got %v", kind)
+	}
+
+	manifest, err := BuildManifest(localDir)
+	if err != nil {
+		return fmt.Errorf("building remote manifest: %v", err)
+	}
+
+	if err := fw.write(frameManifestResponse, manifestResponseFrame{Manifest: manifest}); err != nil {
+		return fmt.Errorf("sending manifest response: %v", err)
+	}
+
+	for {
+		kind, body, err := fr.read()
+		if err != nil {
+			return fmt.Errorf("reading frame: %v", err)
+		}
+
+		switch kind {
+		case frameFileChunk:
+			var chunk fileChunkFrame
+			if err := unmarshalFrame(body, &chunk); err != nil {
+				return fmt.Errorf("decoding file chunk: %v", err)
+			}
+			if err := applyFileChunk(localDir, chunk); err != nil {
+				return fmt.Errorf("applying %s: %v", chunk.Path, err)
+			}
+		case frameDelete:
+			var del deleteFrame
+			if err := unmarshalFrame(body, &del); err != nil {
+				return fmt.Errorf("decoding delete: %v", err)
+			}
+			full, err := safeJoin(localDir, del.Path)
+			if err != nil {
+				return fmt.Errorf("deleting %s: %v", del.Path, err)
+			}
+			if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("deleting %s: %v", del.Path, err)
+			}
+		case frameDone:
+			return nil
+		default:
+			return fmt.Errorf("unexpected frame kind %v", kind)
+		}
+	}
+}
+
+func applyFileChunk(localDir string, chunk fileChunkFrame) error {
+	full, err := safeJoin(localDir, chunk.Path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(full, chunk.Data, os.FileMode(chunk.Mode))
+}
+
+// safeJoin joins rel (a path reported by the far end of the sync
+// protocol) onto localDir and rejects it if the result would fall outside
+// localDir -- e.g. an absolute path, or one that climbs out via ".." --
+// so a sender that disagrees with our manifest (or a compromised peer)
+// can't write or delete files anywhere else the pod process can reach.
+func safeJoin(localDir, rel string) (string, error) {
+	if filepath.IsAbs(rel) {
+		return "", fmt.Errorf("path %q is absolute", rel)
+	}
+
+	full := filepath.Join(localDir, rel)
+	base := filepath.Clean(localDir) + string(filepath.Separator)
+	if !strings.HasPrefix(full, base) {
+		return "", fmt.Errorf("path %q escapes %s", rel, localDir)
+	}
+
+	return full, nil
+}
@@ -0,0 +1,141 @@
+package remote
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingConn wraps a net.Conn's Read side to also copy every byte read
+// into tee, so a test can observe the frames flowing through it without
+// changing how Receive itself reads them.
+type countingConn struct {
+	net.Conn
+	tee io.Writer
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		if _, werr := c.tee.Write(p[:n]); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// runSync drives one Sync/Receive pass over an in-memory full-duplex pipe,
+// the same shape cmd/remote.go wires up between a local Syncer and the pod
+// running `gangplank remote --receive` on its stdio. It returns the
+// manifest Sync built plus the number of FileChunk frames Receive actually
+// saw, so callers can assert on wire behavior (what was shipped) rather
+// than just the resulting file contents (which would look the same even
+// if everything were resent every time).
+func runSync(t *testing.T, s *Syncer, podDir string) (Manifest, int) {
+	t.Helper()
+
+	client, pod := net.Pipe()
+
+	tr, tw := io.Pipe()
+	var fileChunks int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fr := newFrameReader(tr)
+		for {
+			kind, _, err := fr.read()
+			if err != nil {
+				return
+			}
+			if kind == frameFileChunk {
+				atomic.AddInt32(&fileChunks, 1)
+			}
+		}
+	}()
+
+	recvErr := make(chan error, 1)
+	go func() {
+		recvErr <- Receive(&countingConn{Conn: pod, tee: tw}, podDir)
+	}()
+
+	manifest, err := s.Sync(client)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	select {
+	case err := <-recvErr:
+		if err != nil {
+			t.Fatalf("Receive: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Receive did not return")
+	}
+
+	tw.Close()
+	<-done
+
+	return manifest, int(atomic.LoadInt32(&fileChunks))
+}
+
+// TestSyncerTwoConsecutiveRuns exercises the scenario --incremental exists
+// for: a local checkout is synced to a pod, src/config/manifest.yaml is
+// then edited, and a second sync against the same pod checkout ships only
+// the changed file -- asserted directly against the FileChunk frames
+// Receive saw, not just the resulting file contents (which would look
+// identical even if every file were resent each time).
+func TestSyncerTwoConsecutiveRuns(t *testing.T) {
+	localDir := t.TempDir()
+	podDir := t.TempDir()
+
+	manifestPath := filepath.Join(localDir, "src", "config", "manifest.yaml")
+	if err := os.MkdirAll(filepath.Dir(manifestPath), 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(manifestPath, []byte("ref: fedora-coreos\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(localDir, "src", "config", "unchanged.yaml"), []byte("unchanged\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	s := &Syncer{LocalDir: localDir}
+
+	_, firstChunks := runSync(t, s, podDir)
+	if firstChunks != 2 {
+		t.Fatalf("first sync shipped %d file chunks, want 2 (manifest.yaml and unchanged.yaml)", firstChunks)
+	}
+
+	podManifestPath := filepath.Join(podDir, "src", "config", "manifest.yaml")
+	got, err := os.ReadFile(podManifestPath)
+	if err != nil {
+		t.Fatalf("reading synced manifest.yaml: %v", err)
+	}
+	if string(got) != "ref: fedora-coreos\n" {
+		t.Fatalf("unexpected manifest.yaml contents after first sync: %q", got)
+	}
+
+	// Touch manifest.yaml and confirm a second sync against the same pod
+	// checkout ships only that one file over the wire, not unchanged.yaml
+	// too.
+	if err := os.WriteFile(manifestPath, []byte("ref: fedora-coreos-next\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	_, secondChunks := runSync(t, s, podDir)
+	if secondChunks != 1 {
+		t.Fatalf("second sync shipped %d file chunks, want 1 (just the modified manifest.yaml)", secondChunks)
+	}
+
+	got, err = os.ReadFile(podManifestPath)
+	if err != nil {
+		t.Fatalf("reading synced manifest.yaml after second sync: %v", err)
+	}
+	if string(got) != "ref: fedora-coreos-next\n" {
+		t.Fatalf("second sync did not propagate the change, got %q", got)
+	}
+}
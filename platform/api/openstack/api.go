@@ -0,0 +1,308 @@
+// Copyright 2020 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package openstack implements a small wrapper around gophercloud that
+// exposes just enough of the Nova/Neutron/Cinder APIs for
+// platform/machine/openstack to spawn and tear down instances.
+package openstack
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/secgroups"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+
+	"github.com/coreos/mantle/platform"
+)
+
+var plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/api/openstack")
+
+// Options holds the OpenStack-specific parameters needed to authenticate
+// against a cloud and to shape the instances it spawns.
+type Options struct {
+	*platform.Options
+
+	// AuthURL is the Keystone identity endpoint, e.g. https://openstack.example.com:5000/v3
+	AuthURL string
+
+	Region         string
+	TenantID       string
+	TenantName     string
+	Username       string
+	Password       string
+	UserDomain     string
+	ProjectDomain  string
+	Flavor         string
+	Image          string
+	Network        string
+	FloatingIPPool string
+	SecurityGroup  string
+	ConfigDrive    bool
+}
+
+// Machine is a handle to a single Nova instance and the resources that
+// were created on its behalf (a floating IP and a security group).
+type Machine struct {
+	ID        string
+	Name      string
+	PublicIP  string
+	PrivateIP string
+
+	floatingIP    *floatingips.FloatingIP
+	securityGroup string
+	volumeID      string
+}
+
+// API is a thin client around the Nova, Neutron, and Cinder APIs used to
+// drive a single OpenStack project the way platform/api/esx.API drives a
+// single vSphere datacenter.
+type API struct {
+	opts    *Options
+	compute *gophercloud.ServiceClient
+	network *gophercloud.ServiceClient
+	volume  *gophercloud.ServiceClient
+}
+
+// New authenticates against opts.AuthURL and returns an API ready to spawn
+// and destroy instances in opts.Region.
+func New(opts *Options) (*API, error) {
+	provider, err := openstack.AuthenticatedClient(gophercloud.AuthOptions{
+		IdentityEndpoint: opts.AuthURL,
+		Username:         opts.Username,
+		Password:         opts.Password,
+		TenantID:         opts.TenantID,
+		TenantName:       opts.TenantName,
+		DomainName:       opts.UserDomain,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("authenticating to %v: %v", opts.AuthURL, err)
+	}
+
+	compute, err := openstack.NewComputeV2(provider, gophercloud.EndpointOpts{Region: opts.Region})
+	if err != nil {
+		return nil, fmt.Errorf("creating compute client: %v", err)
+	}
+
+	network, err := openstack.NewNetworkV2(provider, gophercloud.EndpointOpts{Region: opts.Region})
+	if err != nil {
+		return nil, fmt.Errorf("creating network client: %v", err)
+	}
+
+	volume, err := openstack.NewBlockStorageV3(provider, gophercloud.EndpointOpts{Region: opts.Region})
+	if err != nil {
+		return nil, fmt.Errorf("creating volume client: %v", err)
+	}
+
+	return &API{
+		opts:    opts,
+		compute: compute,
+		network: network,
+		volume:  volume,
+	}, nil
+}
+
+// CreateServer boots a Nova instance named name running userdata, and
+// (unless opts.FloatingIPPool is empty) allocates and associates a
+// floating IP so the instance is reachable as $public_ipv4. It also
+// creates a 1 GiB Cinder volume for the instance, which Destroy deletes;
+// that volume is not attached to the instance and is left empty. The
+// rendered config reaches the instance as Nova user data, served on a
+// config drive when opts.ConfigDrive is set.
+func (a *API) CreateServer(name, userdata string) (*Machine, error) {
+	// createdSecgroup is only set if this call created the group (as
+	// opposed to reusing a.opts.SecurityGroup), so it's the only one we
+	// clean up on the early-return paths below, before a Machine exists
+	// to hang the cleanup off of via a.Destroy.
+	secgroup := a.opts.SecurityGroup
+	createdSecgroup := ""
+	if secgroup == "" {
+		created, err := secgroups.Create(a.compute, secgroups.CreateOpts{
+			Name:        fmt.Sprintf("%s-sg", name),
+			Description: "kola test instance",
+		}).Extract()
+		if err != nil {
+			return nil, fmt.Errorf("creating security group: %v", err)
+		}
+		secgroup = created.Name
+		createdSecgroup = created.Name
+	}
+
+	vol, err := volumes.Create(a.volume, volumes.CreateOpts{
+		Name: fmt.Sprintf("%s-ignition", name),
+		Size: 1,
+	}, nil).Extract()
+	if err != nil {
+		a.cleanupFailedCreate("", createdSecgroup)
+		return nil, fmt.Errorf("creating config drive volume: %v", err)
+	}
+	if err := volumes.WaitForStatus(a.volume, vol.ID, "available", 60); err != nil {
+		a.cleanupFailedCreate(vol.ID, createdSecgroup)
+		return nil, fmt.Errorf("waiting for config drive volume: %v", err)
+	}
+
+	server, err := servers.Create(a.compute, servers.CreateOpts{
+		Name:           name,
+		FlavorName:     a.opts.Flavor,
+		ImageName:      a.opts.Image,
+		Networks:       []servers.Network{{UUID: a.opts.Network}},
+		SecurityGroups: []string{secgroup},
+		UserData:       []byte(userdata),
+		ConfigDrive:    &a.opts.ConfigDrive,
+	}).Extract()
+	if err != nil {
+		a.cleanupFailedCreate(vol.ID, createdSecgroup)
+		return nil, fmt.Errorf("creating server: %v", err)
+	}
+
+	// mach owns the volume and security group from here on, so any
+	// failure below must go through a.Destroy to avoid leaking them.
+	mach := &Machine{
+		ID:            server.ID,
+		Name:          name,
+		securityGroup: secgroup,
+		volumeID:      vol.ID,
+	}
+
+	if err := servers.WaitForStatus(a.compute, server.ID, "ACTIVE", 300); err != nil {
+		a.Destroy(mach)
+		return nil, fmt.Errorf("waiting for server %v to become active: %v", server.ID, err)
+	}
+
+	server, err = servers.Get(a.compute, server.ID).Extract()
+	if err != nil {
+		a.Destroy(mach)
+		return nil, fmt.Errorf("fetching server %v: %v", server.ID, err)
+	}
+
+	mach.PrivateIP = firstAddress(server.Addresses, a.opts.Network)
+
+	if a.opts.FloatingIPPool != "" {
+		fip, err := floatingips.Create(a.compute, floatingips.CreateOpts{
+			Pool: a.opts.FloatingIPPool,
+		}).Extract()
+		if err != nil {
+			a.Destroy(mach)
+			return nil, fmt.Errorf("allocating floating ip: %v", err)
+		}
+
+		if err := floatingips.AssociateInstance(a.compute, server.ID, floatingips.AssociateOpts{
+			FloatingIP: fip.IP,
+		}).ExtractErr(); err != nil {
+			a.Destroy(mach)
+			return nil, fmt.Errorf("associating floating ip %v with %v: %v", fip.IP, server.ID, err)
+		}
+
+		mach.floatingIP = fip
+		mach.PublicIP = fip.IP
+	} else {
+		mach.PublicIP = mach.PrivateIP
+	}
+
+	return mach, nil
+}
+
+// Destroy releases the floating IP (if any), deletes the instance, and
+// then deletes the config drive volume and the security group created on
+// the instance's behalf. If deleting the instance fails, it returns that
+// error without deleting the volume or the security group.
+func (a *API) Destroy(mach *Machine) error {
+	if mach.floatingIP != nil {
+		if err := floatingips.DisassociateInstance(a.compute, mach.ID, floatingips.DisassociateOpts{
+			FloatingIP: mach.floatingIP.IP,
+		}).ExtractErr(); err != nil {
+			plog.Errorf("disassociating floating ip %v: %v", mach.floatingIP.IP, err)
+		}
+		if err := floatingips.Delete(a.compute, mach.floatingIP.ID).ExtractErr(); err != nil {
+			plog.Errorf("deleting floating ip %v: %v", mach.floatingIP.IP, err)
+		}
+	}
+
+	if err := a.deleteServer(mach.ID); err != nil {
+		return err
+	}
+
+	if mach.volumeID != "" {
+		if err := volumes.Delete(a.volume, mach.volumeID, nil).ExtractErr(); err != nil {
+			plog.Errorf("deleting config drive volume %v: %v", mach.volumeID, err)
+		}
+	}
+
+	if a.opts.SecurityGroup == "" && mach.securityGroup != "" {
+		if err := secgroups.Delete(a.compute, mach.securityGroup).ExtractErr(); err != nil {
+			plog.Errorf("deleting security group %v: %v", mach.securityGroup, err)
+		}
+	}
+
+	return nil
+}
+
+// cleanupFailedCreate tears down the volume and/or security group created
+// partway through a CreateServer call that failed before a Machine existed
+// to drive the cleanup through Destroy. Either argument may be empty if
+// that resource was never created (or, for secgroup, wasn't ours to begin
+// with).
+func (a *API) cleanupFailedCreate(volumeID, secgroup string) {
+	if volumeID != "" {
+		if err := volumes.Delete(a.volume, volumeID, nil).ExtractErr(); err != nil {
+			plog.Errorf("deleting config drive volume %v: %v", volumeID, err)
+		}
+	}
+	if secgroup != "" {
+		if err := secgroups.Delete(a.compute, secgroup).ExtractErr(); err != nil {
+			plog.Errorf("deleting security group %v: %v", secgroup, err)
+		}
+	}
+}
+
+func (a *API) deleteServer(id string) error {
+	if err := servers.Delete(a.compute, id).ExtractErr(); err != nil {
+		return fmt.Errorf("deleting server %v: %v", id, err)
+	}
+	return nil
+}
+
+// ConsoleOutput returns the instance's whole serial console log, the
+// same way platform/api/esx surfaces a VM's console for BaseCluster.
+func (a *API) ConsoleOutput(id string) (string, error) {
+	out, err := servers.ShowConsoleOutput(a.compute, id, servers.ShowConsoleOutputOpts{}).Extract()
+	if err != nil {
+		return "", fmt.Errorf("fetching console output for %v: %v", id, err)
+	}
+	return out, nil
+}
+
+func firstAddress(addrs map[string]interface{}, network string) string {
+	entries, ok := addrs[network].([]interface{})
+	if !ok {
+		return ""
+	}
+	for _, e := range entries {
+		entry, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if addr, ok := entry["addr"].(string); ok {
+			return addr
+		}
+	}
+	return ""
+}
+
+const pollInterval = 5 * time.Second
@@ -32,7 +32,8 @@ import (
 )
 
 type BaseCluster struct {
-	agent *network.SSHAgent
+	agent  *network.SSHAgent
+	dialer network.Dialer
 
 	machlock   sync.Mutex
 	machmap    map[string]Machine
@@ -41,6 +42,8 @@ type BaseCluster struct {
 	bf    *BaseFlight
 	name  string
 	rconf *RuntimeConfig
+
+	updateServer *updateServer
 }
 
 func NewBaseCluster(bf *BaseFlight, rconf *RuntimeConfig) (*BaseCluster, error) {
@@ -56,6 +59,7 @@ func NewBaseClusterWithDialer(bf *BaseFlight, rconf *RuntimeConfig, dialer netwo
 	bc := &BaseCluster{
 		bf:         bf,
 		agent:      agent,
+		dialer:     dialer,
 		machmap:    make(map[string]Machine),
 		consolemap: make(map[string]string),
 		name:       fmt.Sprintf("%s-%s", bf.baseopts.BaseName, uuid.NewV4()),
@@ -147,7 +151,11 @@ func (bc *BaseCluster) Keys() ([]*agent.Key, error) {
 
 func (bc *BaseCluster) RenderUserData(userdata *conf.UserData, ignitionVars map[string]string) (*conf.Conf, error) {
 	if userdata == nil {
-		userdata = conf.Ignition(`{"ignition": {"version": "2.0.0"}}`)
+		version := conf.DefaultIgnitionVersion
+		if bc.bf.baseopts.IgnitionV3 {
+			version = conf.DefaultIgnitionV3Version
+		}
+		userdata = conf.Ignition(fmt.Sprintf(`{"ignition": {"version": "%s"}}`, version))
 	}
 
 	// hacky solution for unified ignition metadata variables
@@ -162,10 +170,20 @@ func (bc *BaseCluster) RenderUserData(userdata *conf.UserData, ignitionVars map[
 		return nil, err
 	}
 
+	if err := conf.Validate(); err != nil {
+		return nil, fmt.Errorf("rendered user data is invalid: %v", err)
+	}
+
 	for _, dropin := range bc.bf.baseopts.SystemdDropins {
 		conf.AddSystemdUnitDropin(dropin.Unit, dropin.Name, dropin.Contents)
 	}
 
+	if bc.updateServer != nil {
+		conf.AddSystemdUnitDropin("update-engine.service", "90-update-url.conf", fmt.Sprintf(`[Service]
+Environment=UPDATE_ENGINE_CLIENT_OPTS=--omaha_url=%s
+`, bc.updateServer.URL()))
+	}
+
 	if !bc.rconf.NoSSHKeyInUserData {
 		keys, err := bc.Keys()
 		if err != nil {
@@ -178,13 +196,19 @@ func (bc *BaseCluster) RenderUserData(userdata *conf.UserData, ignitionVars map[
 	return conf, nil
 }
 
-// Destroy destroys each machine in the cluster and closes the SSH agent.
+// Destroy destroys each machine in the cluster, stops the update server if
+// one was started, and closes the SSH agent.
 func (bc *BaseCluster) Destroy() {
 
 	for _, m := range bc.Machines() {
 		m.Destroy()
 	}
 
+	if bc.updateServer != nil {
+		bc.updateServer.Close()
+		bc.updateServer = nil
+	}
+
 	if err := bc.agent.Close(); err != nil {
 		plog.Errorf("Error closing agent: %v", err)
 	}
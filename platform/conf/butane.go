@@ -0,0 +1,86 @@
+// Copyright 2020 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+
+	goast "github.com/ajeddeloh/go-json"
+	butane "github.com/coreos/butane/config"
+	"github.com/coreos/ignition/v2/config/validate/astjson"
+	"github.com/coreos/ignition/v2/config/validate/astnode"
+)
+
+// DefaultIgnitionV3Version is the spec version RenderUserData hands back
+// for an empty config once the platform asks for spec v3 instead of the
+// legacy v2 default.
+const DefaultIgnitionV3Version = "3.3.0"
+
+// renderButane runs data through github.com/coreos/butane/config to
+// produce Ignition v3 JSON.
+func renderButane(data string) (*Conf, error) {
+	ignJSON, _, err := butane.TranslateBytes([]byte(data), butane.TranslateBytesOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("translating butane config: %v", err)
+	}
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(ignJSON, &parsed); err != nil {
+		return nil, fmt.Errorf("parsing translated ignition config: %v", err)
+	}
+
+	return &Conf{
+		raw:      ignJSON,
+		ignition: parsed,
+		version:  astnode.VersionV3,
+	}, nil
+}
+
+// Validate does a minimal structural check of the rendered Ignition
+// config (that it declares an ignition.version) and, on failure, reports
+// the failure as a line/column/snippet into the rendered Ignition JSON via
+// astjson, rather than a bare error string. It's called from
+// RenderUserData, after Render, so every UserData gets the same check
+// regardless of whether it started as raw Ignition, Butane, or a
+// Container Linux Config.
+//
+// There's deliberately no attempt to map the error back into Butane YAML
+// or CLC source: butane.TranslateBytes and the CLC transpiler don't hand
+// back a byte-accurate offset map from the JSON they produce to the
+// source they produced it from, so a "line in the original source" would
+// just be a made-up constant. Reporting against the real rendered JSON
+// (using c.version to pick the right astnode.AstNode offsets) is less
+// friendly but actually accurate.
+func (c *Conf) Validate() error {
+	if c.ignition == nil {
+		return nil
+	}
+
+	if section, ok := c.ignition["ignition"].(map[string]interface{}); ok {
+		if version, _ := section["version"].(string); version != "" {
+			return nil
+		}
+	}
+
+	var root goast.Node
+	if err := goast.Unmarshal(c.raw, &root); err != nil {
+		return fmt.Errorf("re-parsing rendered config: %v", err)
+	}
+
+	node := astjson.FromJsonRootVersion(root, c.version)
+	line, col, source := node.ValueLineCol(c.raw)
+	return fmt.Errorf("config is missing ignition.version (line %d, column %d):\n%s", line, col, source)
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+
+	ctconfig "github.com/coreos/container-linux-config-transpiler/config"
+)
+
+// renderContainerLinuxConfig parses data as a Container Linux Config and
+// converts it to Ignition JSON for ctPlatform (e.g. "aws", "azure",
+// "openstack-metadata"), the way cosa has always transpiled CLCs before
+// handing them to a platform's NewMachine.
+func renderContainerLinuxConfig(data, ctPlatform string) (*Conf, error) {
+	cfg, ast, r := ctconfig.Parse([]byte(data))
+	if r.IsFatal() {
+		return nil, fmt.Errorf("parsing container linux config: %s", r.String())
+	}
+
+	ignCfg, r := ctconfig.Convert(cfg, ctPlatform, ast)
+	if r.IsFatal() {
+		return nil, fmt.Errorf("converting container linux config for platform %q: %s", ctPlatform, r.String())
+	}
+
+	ignJSON, err := json.Marshal(ignCfg)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling converted ignition config: %v", err)
+	}
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(ignJSON, &parsed); err != nil {
+		return nil, fmt.Errorf("parsing converted ignition config: %v", err)
+	}
+
+	return &Conf{raw: ignJSON, ignition: parsed}, nil
+}
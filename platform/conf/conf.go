@@ -0,0 +1,274 @@
+// Copyright 2020 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package conf renders the various shapes of user data kola's platforms
+// accept (raw Ignition JSON, Container Linux Config YAML, and Butane
+// YAML) down into a single Conf that can be substituted, have keys and
+// systemd units injected, and be written out for a machine to boot with.
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/coreos/ignition/v2/config/validate/astnode"
+)
+
+// DefaultIgnitionVersion is the spec version used for an empty config when
+// the caller didn't ask for anything more specific.
+const DefaultIgnitionVersion = "2.0.0"
+
+type kind int
+
+const (
+	kindIgnition kind = iota
+	kindButane
+	kindCloudConfig
+	kindContainerLinuxConfig
+	kindUnknown
+)
+
+// UserData is a not-yet-rendered blob of user data together with enough
+// information to know how to turn it into a Conf.
+type UserData struct {
+	kind kind
+	data string
+}
+
+// Ignition wraps raw Ignition JSON.
+func Ignition(data string) *UserData {
+	return &UserData{kind: kindIgnition, data: data}
+}
+
+// Butane wraps Butane YAML, which Render translates to Ignition v3 JSON
+// via github.com/coreos/butane/config before building the Conf.
+func Butane(data string) *UserData {
+	return &UserData{kind: kindButane, data: data}
+}
+
+// CloudConfig wraps a #cloud-config document.
+func CloudConfig(data string) *UserData {
+	return &UserData{kind: kindCloudConfig, data: data}
+}
+
+// ContainerLinuxConfig wraps a Container Linux Config YAML document, which
+// Render transpiles to Ignition JSON for ctPlatform via
+// github.com/coreos/container-linux-config-transpiler/config.
+func ContainerLinuxConfig(data string) *UserData {
+	return &UserData{kind: kindContainerLinuxConfig, data: data}
+}
+
+// Unknown wraps a blob whose kind hasn't been determined yet; Render will
+// sniff it the same way cosa does.
+func Unknown(data string) *UserData {
+	return &UserData{kind: kindUnknown, data: data}
+}
+
+// IsIgnitionCompatible reports whether Render will produce an Ignition
+// config, i.e. whether $public_ipv4-style ignitionVars substitution is
+// meaningful for this UserData.
+func (u *UserData) IsIgnitionCompatible() bool {
+	switch u.kind {
+	case kindIgnition, kindButane, kindContainerLinuxConfig:
+		return true
+	case kindUnknown:
+		return looksLikeIgnition(u.data) || looksLikeButane(u.data) || !looksLikeCloudConfig(u.data)
+	default:
+		return false
+	}
+}
+
+// Subst returns a copy of u with every occurrence of old replaced by new
+// in its raw data.
+func (u *UserData) Subst(old, new string) *UserData {
+	next := *u
+	next.data = strings.ReplaceAll(u.data, old, new)
+	return &next
+}
+
+// Render turns the wrapped user data into a Conf. ctPlatform names the
+// Container Linux Config transpiler platform to target when the data is a
+// Container Linux Config; it is ignored for Ignition and Butane, which
+// carry no platform-specific transpilation step.
+func (u *UserData) Render(ctPlatform string) (*Conf, error) {
+	switch u.resolveKind() {
+	case kindButane:
+		return renderButane(u.data)
+	case kindCloudConfig:
+		return &Conf{raw: []byte(u.data), isCloudConfig: true}, nil
+	case kindContainerLinuxConfig:
+		return renderContainerLinuxConfig(u.data, ctPlatform)
+	default:
+		return renderIgnition([]byte(u.data))
+	}
+}
+
+func (u *UserData) resolveKind() kind {
+	if u.kind != kindUnknown {
+		return u.kind
+	}
+	if looksLikeButane(u.data) {
+		return kindButane
+	}
+	if looksLikeIgnition(u.data) {
+		return kindIgnition
+	}
+	if looksLikeCloudConfig(u.data) {
+		return kindCloudConfig
+	}
+	return kindContainerLinuxConfig
+}
+
+func looksLikeIgnition(data string) bool {
+	return strings.Contains(data, `"ignition"`)
+}
+
+func looksLikeButane(data string) bool {
+	return strings.Contains(data, "variant:") && !strings.Contains(data, `"ignition"`)
+}
+
+// looksLikeCloudConfig reports whether data is a cloud-init #cloud-config
+// document, which cloud-init requires to start with that exact header,
+// unlike a Container Linux Config which carries no such marker.
+func looksLikeCloudConfig(data string) bool {
+	return strings.HasPrefix(strings.TrimSpace(data), "#cloud-config")
+}
+
+func renderIgnition(data []byte) (*Conf, error) {
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("parsing ignition config: %v", err)
+	}
+	return &Conf{raw: data, ignition: parsed}, nil
+}
+
+// Conf is a fully rendered, ready-to-boot configuration.
+type Conf struct {
+	raw           []byte
+	ignition      map[string]interface{}
+	isCloudConfig bool
+
+	// version is the Ignition spec version raw was produced against, so
+	// Validate knows which of astnode.AstNode's offset fields to trust
+	// when reporting a position in raw. Butane always translates to spec
+	// v3; everything else defaults to the zero value, astnode.VersionV2.
+	version astnode.Version
+}
+
+// String returns the rendered config as text.
+func (c *Conf) String() string {
+	if c.ignition == nil {
+		return string(c.raw)
+	}
+	data, err := json.Marshal(c.ignition)
+	if err != nil {
+		return string(c.raw)
+	}
+	return string(data)
+}
+
+// WriteFile writes the rendered config to path.
+func (c *Conf) WriteFile(path string) error {
+	return ioutil.WriteFile(path, []byte(c.String()), 0644)
+}
+
+// AddSystemdUnit adds (or replaces) a systemd unit in the config.
+func (c *Conf) AddSystemdUnit(name, contents string, enable bool) {
+	c.addUnit(name, contents, "", enable)
+}
+
+// AddSystemdUnitDropin adds a drop-in to an existing systemd unit.
+func (c *Conf) AddSystemdUnitDropin(unit, name, contents string) {
+	c.addUnit(unit, "", name, false)
+	c.setDropinContents(unit, name, contents)
+}
+
+// CopyKeys installs keys as the core user's authorized SSH keys.
+func (c *Conf) CopyKeys(keys []*agent.Key) {
+	if c.ignition == nil {
+		return
+	}
+
+	authorized := make([]string, len(keys))
+	for i, k := range keys {
+		authorized[i] = k.String()
+	}
+
+	passwd, _ := c.ignition["passwd"].(map[string]interface{})
+	if passwd == nil {
+		passwd = map[string]interface{}{}
+		c.ignition["passwd"] = passwd
+	}
+
+	users, _ := passwd["users"].([]interface{})
+	passwd["users"] = append(users, map[string]interface{}{
+		"name":              "core",
+		"sshAuthorizedKeys": authorized,
+	})
+}
+
+func (c *Conf) addUnit(name, contents, dropinName string, enable bool) {
+	if c.ignition == nil {
+		return
+	}
+
+	systemd, _ := c.ignition["systemd"].(map[string]interface{})
+	if systemd == nil {
+		systemd = map[string]interface{}{}
+		c.ignition["systemd"] = systemd
+	}
+
+	units, _ := systemd["units"].([]interface{})
+	for _, raw := range units {
+		if u, ok := raw.(map[string]interface{}); ok && u["name"] == name {
+			if contents != "" {
+				u["contents"] = contents
+			}
+			if enable {
+				u["enabled"] = true
+			}
+			return
+		}
+	}
+
+	unit := map[string]interface{}{"name": name}
+	if contents != "" {
+		unit["contents"] = contents
+	}
+	if enable {
+		unit["enabled"] = true
+	}
+	systemd["units"] = append(units, unit)
+}
+
+func (c *Conf) setDropinContents(unit, name, contents string) {
+	systemd, _ := c.ignition["systemd"].(map[string]interface{})
+	units, _ := systemd["units"].([]interface{})
+	for _, raw := range units {
+		u, ok := raw.(map[string]interface{})
+		if !ok || u["name"] != unit {
+			continue
+		}
+		dropins, _ := u["dropins"].([]interface{})
+		u["dropins"] = append(dropins, map[string]interface{}{
+			"name":     name,
+			"contents": contents,
+		})
+		return
+	}
+}
@@ -15,6 +15,7 @@
 package local
 
 import (
+	"fmt"
 	"net"
 	"runtime"
 
@@ -59,3 +60,70 @@ func (d *NsDialer) Dial(network, address string) (net.Conn, error) {
 
 	return d.RetryDialer.Dial(network, address)
 }
+
+// Listen opens address for listening inside the dialer's network
+// namespace, so that a server started on the host side (e.g. the update
+// payload server started by BaseCluster.StartUpdateServer) is reachable
+// from machines living in that namespace.
+func (d *NsDialer) Listen(network, address string) (net.Listener, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origns, err := netns.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer netns.Set(origns)
+
+	if err := netns.Set(d.NsHandle); err != nil {
+		return nil, err
+	}
+
+	return net.Listen(network, address)
+}
+
+// InterfaceAddr returns the first global unicast IPv4 address configured
+// inside the dialer's network namespace. A server that binds to this
+// address instead of the wildcard address is reachable from machines
+// living on the other side of the tunnel, since they only ever route to
+// addresses inside that namespace.
+func (d *NsDialer) InterfaceAddr() (net.IP, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origns, err := netns.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer netns.Set(origns)
+
+	if err := netns.Set(d.NsHandle); err != nil {
+		return nil, err
+	}
+
+	return FirstGlobalUnicastIPv4()
+}
+
+// FirstGlobalUnicastIPv4 returns the first global unicast IPv4 address
+// (so neither loopback nor link-local) configured on any interface in the
+// current network namespace.
+func FirstGlobalUnicastIPv4() (net.IP, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip4 := ipnet.IP.To4()
+		if ip4 == nil || !ip4.IsGlobalUnicast() {
+			continue
+		}
+		return ip4, nil
+	}
+
+	return nil, fmt.Errorf("no global unicast IPv4 address found")
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openstack
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/api/openstack"
+)
+
+type machine struct {
+	cluster *cluster
+	mach    *openstack.Machine
+	dir     string
+	journal *platform.Journal
+	console string
+}
+
+func (om *machine) ID() string {
+	return om.mach.Name
+}
+
+func (om *machine) IP() string {
+	return om.mach.PublicIP
+}
+
+func (om *machine) PrivateIP() string {
+	return om.mach.PrivateIP
+}
+
+func (om *machine) RuntimeConf() platform.RuntimeConfig {
+	return om.cluster.RuntimeConf()
+}
+
+func (om *machine) SSHClient() (*ssh.Client, error) {
+	return om.cluster.SSHClient(om.IP())
+}
+
+func (om *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
+	return om.cluster.PasswordSSHClient(om.IP(), user, password)
+}
+
+func (om *machine) SSHSession() (*ssh.Session, error) {
+	client, err := om.SSHClient()
+	if err != nil {
+		return nil, fmt.Errorf("Error establishing ssh client: %v", err)
+	}
+	return client.NewSession()
+}
+
+func (om *machine) SSH(cmd string) ([]byte, []byte, error) {
+	return om.cluster.SSH(om, cmd)
+}
+
+func (om *machine) Reboot() error {
+	return platform.RebootMachine(om, om.journal)
+}
+
+// Destroy disassociates and releases the machine's floating IP, deletes the
+// config drive volume and any security group created on its behalf, and
+// terminates the Nova instance, same as esx.machine.Destroy but backed by
+// the OpenStack API.
+func (om *machine) Destroy() {
+	if err := om.saveConsole(); err != nil {
+		plog.Errorf("Error saving console for instance %v: %v", om.ID(), err)
+	}
+
+	if err := om.cluster.api.Destroy(om.mach); err != nil {
+		plog.Errorf("Error terminating instance %v: %v", om.ID(), err)
+	}
+
+	if om.journal != nil {
+		om.journal.Destroy()
+	}
+
+	om.cluster.DelMach(om)
+}
+
+func (om *machine) saveConsole() error {
+	out, err := om.cluster.api.ConsoleOutput(om.mach.ID)
+	if err != nil {
+		return err
+	}
+	om.console = out
+	return nil
+}
+
+func (om *machine) ConsoleOutput() string {
+	return om.console
+}
+
+func (om *machine) JournalOutput() string {
+	if om.journal == nil {
+		return ""
+	}
+
+	data, err := om.journal.Read()
+	if err != nil {
+		plog.Errorf("Error reading journal for instance %v: %v", om.ID(), err)
+	}
+	return string(data)
+}
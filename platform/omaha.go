@@ -0,0 +1,227 @@
+// Copyright 2020 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/coreos/mantle/platform/local"
+)
+
+// Updater is notified of every Omaha update-check and event ping a machine
+// sends to the update server started by BaseCluster.StartUpdateServer.
+// Tests register one to observe update-engine's behavior without having to
+// poll the machine over SSH.
+type Updater interface {
+	// UpdateCheck is called when a machine polls for an update.
+	UpdateCheck(appID string)
+	// UpdateEvent is called when a machine reports the result of applying
+	// an update (eventtype/eventresult, as sent by update_engine).
+	UpdateEvent(appID string, eventType, eventResult int)
+}
+
+// updateServer is a minimal Omaha v3 server that always points machines at
+// a single payload. It backs BaseCluster.StartUpdateServer so that
+// update-engine tests can run the same way on every platform instead of
+// only against qemu's LocalCluster.OmahaServer.
+type updateServer struct {
+	listener net.Listener
+	payload  string
+	sha256   string
+	size     int64
+
+	lock     sync.Mutex
+	updaters []Updater
+}
+
+func newUpdateServer(ln net.Listener, payload string) (*updateServer, error) {
+	f, err := os.Open(payload)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &updateServer{
+		listener: ln,
+		payload:  payload,
+		sha256:   base64.StdEncoding.EncodeToString(h.Sum(nil)),
+		size:     size,
+	}
+
+	return srv, nil
+}
+
+// URL is the Omaha endpoint update_engine_client should be pointed at.
+// updateListener binds to a concrete, reachable address rather than the
+// wildcard address, so this is safe to hand to a machine directly.
+func (s *updateServer) URL() string {
+	return fmt.Sprintf("http://%s/update", s.listener.Addr().String())
+}
+
+func (s *updateServer) Serve() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/update", s.serveOmaha)
+	mux.HandleFunc("/payload/", s.servePayload)
+	http.Serve(s.listener, mux)
+}
+
+func (s *updateServer) Close() {
+	s.listener.Close()
+}
+
+func (s *updateServer) RegisterUpdater(u Updater) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.updaters = append(s.updaters, u)
+}
+
+func (s *updateServer) notifyCheck(appID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, u := range s.updaters {
+		u.UpdateCheck(appID)
+	}
+}
+
+func (s *updateServer) notifyEvent(appID string, eventType, eventResult int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, u := range s.updaters {
+		u.UpdateEvent(appID, eventType, eventResult)
+	}
+}
+
+// omahaRequest is the subset of the Omaha v3 protocol request body that
+// update_engine actually sends: one <app> with either an <updatecheck> or
+// an <event>.
+type omahaRequest struct {
+	XMLName xml.Name `xml:"request"`
+	Apps    []struct {
+		AppID       string    `xml:"appid,attr"`
+		UpdateCheck *struct{} `xml:"updatecheck"`
+		Event       *struct {
+			Type   int `xml:"eventtype,attr"`
+			Result int `xml:"eventresult,attr"`
+		} `xml:"event"`
+	} `xml:"app"`
+}
+
+func (s *updateServer) serveOmaha(w http.ResponseWriter, r *http.Request) {
+	var req omahaRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><response protocol="3.0">`)
+	for _, app := range req.Apps {
+		switch {
+		case app.Event != nil:
+			s.notifyEvent(app.AppID, app.Event.Type, app.Event.Result)
+			fmt.Fprintf(w, `<app appid="%s"><event status="ok"/></app>`, app.AppID)
+		case app.UpdateCheck != nil:
+			s.notifyCheck(app.AppID)
+			fmt.Fprintf(w, `<app appid="%s"><updatecheck status="ok">`+
+				`<urls><url codebase="http://%s/payload/"/></urls>`+
+				`<manifest version="0.0.0">`+
+				`<packages><package name="%s" hash_sha256="%s" size="%d" required="true"/></packages>`+
+				`<actions><action event="postinstall" sha256="%s"/></actions>`+
+				`</manifest></updatecheck></app>`,
+				app.AppID, s.listener.Addr().String(), filepath.Base(s.payload), s.sha256, s.size, s.sha256)
+		default:
+			fmt.Fprintf(w, `<app appid="%s"><updatecheck status="noupdate"/></app>`, app.AppID)
+		}
+	}
+	fmt.Fprint(w, `</response>`)
+}
+
+func (s *updateServer) servePayload(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, s.payload)
+}
+
+// StartUpdateServer starts an Omaha v3 server on the host that serves
+// payload (a path to an already-built update_engine payload) and arranges
+// for machines spawned afterwards to have update_engine_client pointed at
+// it via RenderUserData. It returns the Omaha URL to check status against.
+//
+// If the cluster's dialer enters a network namespace (as local.NsDialer
+// does for the qemu platforms), the listener is created inside that
+// namespace so it stays reachable from machines on the other side of the
+// tunnel; otherwise it is opened directly on the host.
+func (bc *BaseCluster) StartUpdateServer(payload string) (string, error) {
+	if bc.updateServer != nil {
+		return "", fmt.Errorf("update server is already running for cluster %s", bc.name)
+	}
+
+	ln, err := bc.updateListener()
+	if err != nil {
+		return "", fmt.Errorf("starting update server listener: %v", err)
+	}
+
+	srv, err := newUpdateServer(ln, payload)
+	if err != nil {
+		ln.Close()
+		return "", fmt.Errorf("starting update server: %v", err)
+	}
+
+	bc.updateServer = srv
+	go srv.Serve()
+
+	return srv.URL(), nil
+}
+
+// RegisterUpdater adds u to the set of Updaters notified of every ping and
+// event the running update server receives. StartUpdateServer must have
+// been called first.
+func (bc *BaseCluster) RegisterUpdater(u Updater) error {
+	if bc.updateServer == nil {
+		return fmt.Errorf("no update server running for cluster %s", bc.name)
+	}
+	bc.updateServer.RegisterUpdater(u)
+	return nil
+}
+
+func (bc *BaseCluster) updateListener() (net.Listener, error) {
+	if ns, ok := bc.dialer.(*local.NsDialer); ok {
+		addr, err := ns.InterfaceAddr()
+		if err != nil {
+			return nil, fmt.Errorf("finding reachable address in network namespace: %v", err)
+		}
+		return ns.Listen("tcp", fmt.Sprintf("%s:0", addr))
+	}
+
+	addr, err := local.FirstGlobalUnicastIPv4()
+	if err != nil {
+		return nil, fmt.Errorf("finding reachable host address: %v", err)
+	}
+	return net.Listen("tcp", fmt.Sprintf("%s:0", addr))
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestServeOmahaUpdateCheck POSTs the request body update_engine_client
+// actually sends for "-check_for_update" (an <app> with an empty
+// <updatecheck/>, no <event>) and checks the server recognizes it as an
+// update check rather than falling through to the no-op default branch.
+func TestServeOmahaUpdateCheck(t *testing.T) {
+	dir := t.TempDir()
+	payloadPath := filepath.Join(dir, "update.gz")
+	if err := os.WriteFile(payloadPath, []byte("fake payload"), 0644); err != nil {
+		t.Fatalf("writing fake payload: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer ln.Close()
+
+	srv, err := newUpdateServer(ln, payloadPath)
+	if err != nil {
+		t.Fatalf("newUpdateServer: %v", err)
+	}
+
+	const body = `<?xml version="1.0" encoding="UTF-8"?>
+<request protocol="3.0">
+  <app appid="{example-app-id}" version="1.0.0">
+    <updatecheck/>
+  </app>
+</request>`
+
+	req := httptest.NewRequest("POST", "/update", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	srv.serveOmaha(rec, req)
+
+	resp := rec.Body.String()
+	if strings.Contains(resp, `status="noupdate"`) {
+		t.Fatalf("updatecheck was not recognized, server returned noupdate: %s", resp)
+	}
+	if !strings.Contains(resp, "hash_sha256=\""+srv.sha256+"\"") {
+		t.Fatalf("response did not include the payload hash: %s", resp)
+	}
+	if !strings.Contains(resp, filepath.Base(payloadPath)) {
+		t.Fatalf("response did not include the payload URL: %s", resp)
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+// ClusterConstructor builds a Cluster for a registered platform.Name out of
+// whatever flags that platform's cmd/kola subcommand parsed into its own
+// options struct.
+type ClusterConstructor func(rconf *RuntimeConfig) (Cluster, error)
+
+// Registry maps a platform.Name to the constructor its cmd/kola subcommand
+// registered in its init(), so that kola can spawn a Cluster for any
+// platform it was built with without importing every platform/machine
+// package directly.
+var Registry = map[Name]ClusterConstructor{}
+
+// RegisterPlatform records the constructor a platform's cmd/kola subcommand
+// uses to build its Cluster. Each cmd/kola subcommand calls this from its
+// init(), so this package never imports platform/machine/* directly and
+// there is no dependency cycle between platform and platform/machine/*.
+func RegisterPlatform(name Name, ctor ClusterConstructor) {
+	Registry[name] = ctor
+}
@@ -20,18 +20,35 @@ import (
 	"github.com/coreos/ignition/v2/config/validate/util"
 )
 
-type JsonNode json.Node
+// JsonNode wraps a parsed JSON AST node together with the Ignition spec
+// version it was parsed against. Spec v3 nodes carry richer offset
+// information (KeyEnd/ValueEnd/Start) than v2's, which matters once the
+// node may have been produced by translating Butane YAML rather than by
+// parsing Ignition JSON directly.
+type JsonNode struct {
+	json.Node
+	version astnode.Version
+}
 
+// FromJsonRoot wraps n as a v2 node, preserving the old default for
+// callers that haven't been taught about spec versions yet.
 func FromJsonRoot(n json.Node) JsonNode {
-	return JsonNode(n)
+	return FromJsonRootVersion(n, astnode.VersionV2)
+}
+
+// FromJsonRootVersion wraps n the same way FromJsonRoot does, but tags it
+// with the Ignition spec version it was parsed as so ValueLineCol and
+// KeyLineCol know which of json.Node's offset fields to trust.
+func FromJsonRootVersion(n json.Node, version astnode.Version) JsonNode {
+	return JsonNode{Node: n, version: version}
 }
 
 func (n JsonNode) ValueLineCol(source []byte) (int, int, string) {
-	return posFromOffset(n.End, source)
+	return posFromOffset(n.version, n.Start, n.End, source)
 }
 
 func (n JsonNode) KeyLineCol(source []byte) (int, int, string) {
-	return posFromOffset(n.KeyEnd, source)
+	return posFromOffset(n.version, n.Start, n.KeyEnd, source)
 }
 
 func (n JsonNode) LiteralValue() interface{} {
@@ -40,7 +57,7 @@ func (n JsonNode) LiteralValue() interface{} {
 
 func (n JsonNode) SliceChild(index int) (astnode.AstNode, bool) {
 	if slice, ok := n.Value.([]json.Node); ok {
-		return JsonNode(slice[index]), true
+		return FromJsonRootVersion(slice[index], n.version), true
 	}
 	return JsonNode{}, false
 }
@@ -49,7 +66,7 @@ func (n JsonNode) KeyValueMap() (map[string]astnode.AstNode, bool) {
 	if kvmap, ok := n.Value.(map[string]json.Node); ok {
 		newKvmap := map[string]astnode.AstNode{}
 		for k, v := range kvmap {
-			newKvmap[k] = JsonNode(v)
+			newKvmap[k] = FromJsonRootVersion(v, n.version)
 		}
 		return newKvmap, true
 	}
@@ -60,10 +77,18 @@ func (n JsonNode) Tag() string {
 	return "json"
 }
 
-// wrapper for errorutil that handles missing sources sanely and resets the reader afterwards
-func posFromOffset(offset int, source []byte) (int, int, string) {
+// wrapper for errorutil that handles missing sources sanely and resets the
+// reader afterwards. v2 nodes only ever populate End/KeyEnd, but v3 nodes
+// also report Start and sometimes leave End unset for nodes with no
+// trailing punctuation of their own (e.g. an object's closing key); in
+// that case fall back to Start so the reported position still lands
+// inside the node instead of at the top of the document.
+func posFromOffset(version astnode.Version, start, offset int, source []byte) (int, int, string) {
 	if source == nil {
 		return 0, 0, ""
 	}
+	if version == astnode.VersionV3 && offset == 0 && start != 0 {
+		offset = start
+	}
 	return util.Highlight(source, int64(offset))
 }
@@ -0,0 +1,44 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package astnode defines the interface a parsed config AST node must
+// implement so that validate/util can report line/column errors against it
+// regardless of the underlying parser (e.g. astjson).
+package astnode
+
+// AstNode is implemented by a node of whatever AST a config was parsed
+// into, so validation errors can be traced back to a source position
+// without validate/util needing to know the concrete parser in use.
+type AstNode interface {
+	ValueLineCol(source []byte) (int, int, string)
+	KeyLineCol(source []byte) (int, int, string)
+	LiteralValue() interface{}
+	SliceChild(index int) (AstNode, bool)
+	KeyValueMap() (map[string]AstNode, bool)
+	Tag() string
+}
+
+// Version identifies the Ignition config spec an AstNode was parsed
+// against (or translated to, in the case of a Butane source), so a node
+// implementation knows which of its offset fields to trust when computing
+// a line/column position.
+type Version int
+
+const (
+	// VersionV2 marks a node parsed from an Ignition spec v2 config.
+	VersionV2 Version = iota
+	// VersionV3 marks a node parsed from an Ignition spec v3 config, or
+	// translated into one from a Butane config.
+	VersionV3
+)